@@ -2,23 +2,56 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 )
 
+// statusClientClosedRequest mirrors nginx's convention for a request
+// whose client disconnected before the server could respond; net/http
+// has no built-in constant for it.
+const statusClientClosedRequest = 499
+
+// errCircuitOpen is returned by CreateMessage when the breaker is open
+// and the call is failed fast without ever reaching the Claude API.
+var errCircuitOpen = errors.New("circuit breaker open: Claude API unavailable")
+
+// classifyExecuteError maps a failed Claude call to an HTTP status that
+// lets callers distinguish "the deadline passed" from "the client gave
+// up" from an ordinary upstream failure, so they can decide whether a
+// retry is worthwhile.
+func classifyExecuteError(err error) int {
+	switch {
+	case errors.Is(err, errSessionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest
+	case errors.Is(err, errCircuitOpen):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // ============================================================================
 // Request/Response Models (Agent Protocol Contract)
 // ============================================================================
 
 type AgentInput struct {
-	Prompt  string                 `json:"prompt"`
-	Context map[string]interface{} `json:"context,omitempty"`
+	Prompt    string                 `json:"prompt"`
+	Context   map[string]interface{} `json:"context,omitempty"`
+	SessionID string                 `json:"sessionId,omitempty"`
 }
 
 type AgentMetadata struct {
@@ -74,21 +107,35 @@ type RootResponse struct {
 // Claude API Client
 // ============================================================================
 
+// ClaudeMessage.Content is usually a plain string, but tool-use turns
+// require structured content blocks instead ([]ClaudeContent for an
+// assistant turn being replayed, []ToolResultBlock for the tool
+// results that follow it), so it's left as interface{} and marshaled
+// as-is.
 type ClaudeMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
 }
 
 type ClaudeRequest struct {
-	Model     string          `json:"model"`
-	MaxTokens int             `json:"max_tokens"`
-	System    string          `json:"system,omitempty"`
-	Messages  []ClaudeMessage `json:"messages"`
+	Model       string           `json:"model"`
+	MaxTokens   int              `json:"max_tokens"`
+	System      string           `json:"system,omitempty"`
+	Messages    []ClaudeMessage  `json:"messages"`
+	Tools       []ToolDefinition `json:"tools,omitempty"`
+	Temperature float64          `json:"temperature"`
+	Stream      bool             `json:"stream,omitempty"`
 }
 
+// ClaudeContent is a single content block in a Claude response. Text
+// blocks only populate Type/Text; tool_use blocks also populate
+// ID/Name/Input.
 type ClaudeContent struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+	Type  string          `json:"type"`
+	Text  string          `json:"text,omitempty"`
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
 }
 
 type ClaudeUsage struct {
@@ -106,10 +153,9 @@ type ClaudeResponse struct {
 }
 
 type ClaudeClient struct {
-	apiKey             string
-	model              string
-	inputCostPerToken  float64
-	outputCostPerToken float64
+	apiKey     string
+	breaker    *circuitBreaker
+	httpClient *http.Client
 }
 
 func NewClaudeClient() (*ClaudeClient, error) {
@@ -119,31 +165,79 @@ func NewClaudeClient() (*ClaudeClient, error) {
 	}
 
 	return &ClaudeClient{
-		apiKey:             apiKey,
-		model:              "claude-sonnet-4-5-20250929",
-		inputCostPerToken:  3.0 / 1_000_000,  // $3 per 1M tokens
-		outputCostPerToken: 15.0 / 1_000_000, // $15 per 1M tokens
+		apiKey:     apiKey,
+		breaker:    newCircuitBreaker(circuitFailureThreshold, circuitCooldown),
+		httpClient: &http.Client{},
 	}, nil
 }
 
-func (c *ClaudeClient) CalculateCost(inputTokens, outputTokens int) float64 {
-	inputCost := float64(inputTokens) * c.inputCostPerToken
-	outputCost := float64(outputTokens) * c.outputCostPerToken
-	// Round to 4 decimal places
-	return float64(int((inputCost+outputCost)*10000)) / 10000
+// CreateMessage sends a request to the Claude Messages API under cfg
+// (model, max tokens, temperature), retrying transient failures with
+// exponential backoff and full jitter, and failing fast through a
+// circuit breaker once failures start piling up (see retry.go).
+// Terminal failures (bad request, auth, etc.) and context cancellation
+// are returned immediately without retrying.
+func (c *ClaudeClient) CreateMessage(ctx context.Context, cfg RuntimeConfig, system string, messages []ClaudeMessage, tools []ToolDefinition) (*ClaudeResponse, error) {
+	logger := loggerFromContext(ctx)
+
+	var lastErr error
+	for attempt := 0; attempt <= maxRetryAttempts; attempt++ {
+		if !c.breaker.Allow() {
+			metrics.recordRetry("circuit_open")
+			return nil, errCircuitOpen
+		}
+
+		response, err := c.doCreateMessage(ctx, cfg, system, messages, tools)
+		if err == nil {
+			c.breaker.RecordSuccess()
+			return response, nil
+		}
+		lastErr = err
+
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			c.breaker.Release()
+			return nil, ctxErr
+		}
+		if !isRetryableError(err) {
+			c.breaker.Release()
+			return nil, err
+		}
+		// Only transient failures count toward tripping the breaker - a
+		// terminal fault (bad request, auth) is a bug in the caller, not
+		// evidence the Claude API itself is unhealthy.
+		c.breaker.RecordFailure()
+		if attempt == maxRetryAttempts {
+			return nil, err
+		}
+
+		delay := fullJitterBackoff(attempt)
+		if apiErr, ok := asClaudeAPIError(err); ok && apiErr.RetryAfter > 0 {
+			delay = apiErr.RetryAfter
+		}
+
+		metrics.recordRetry("retry")
+		logger.Warn("retrying Claude API call", "attempt", attempt+1, "delay", delay.String(), "error", err.Error())
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, lastErr
 }
 
-func (c *ClaudeClient) CreateMessage(system, userMessage string) (*ClaudeResponse, error) {
+// doCreateMessage performs a single HTTP round-trip against the
+// Claude Messages API, with no retry logic of its own.
+func (c *ClaudeClient) doCreateMessage(ctx context.Context, cfg RuntimeConfig, system string, messages []ClaudeMessage, tools []ToolDefinition) (*ClaudeResponse, error) {
 	reqBody := ClaudeRequest{
-		Model:     c.model,
-		MaxTokens: 4000,
-		System:    system,
-		Messages: []ClaudeMessage{
-			{
-				Role:    "user",
-				Content: userMessage,
-			},
-		},
+		Model:       cfg.Model,
+		MaxTokens:   cfg.MaxTokens,
+		System:      system,
+		Messages:    messages,
+		Tools:       tools,
+		Temperature: cfg.Temperature,
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -151,7 +245,7 @@ func (c *ClaudeClient) CreateMessage(system, userMessage string) (*ClaudeRespons
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -160,8 +254,10 @@ func (c *ClaudeClient) CreateMessage(system, userMessage string) (*ClaudeRespons
 	req.Header.Set("x-api-key", c.apiKey)
 	req.Header.Set("anthropic-version", "2023-06-01")
 
-	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Do(req)
+	// No client-wide Timeout here: ctx carries the caller's deadline
+	// (derived from AgentMetadata.Timeout), so cancellation is governed
+	// by the context rather than a fixed duration.
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -173,7 +269,7 @@ func (c *ClaudeClient) CreateMessage(system, userMessage string) (*ClaudeRespons
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Claude API error (%d): %s", resp.StatusCode, string(body))
+		return nil, newClaudeAPIError(resp, body)
 	}
 
 	var claudeResp ClaudeResponse
@@ -190,6 +286,11 @@ func (c *ClaudeClient) CreateMessage(system, userMessage string) (*ClaudeRespons
 
 type GoAgent struct {
 	client *ClaudeClient
+	tools  *ToolRegistry
+
+	configMu   sync.RWMutex
+	config     RuntimeConfig
+	configPath string
 }
 
 func NewGoAgent() (*GoAgent, error) {
@@ -198,70 +299,139 @@ func NewGoAgent() (*GoAgent, error) {
 		return nil, err
 	}
 
+	tools := NewToolRegistry()
+	tools.Register("http_get", "Fetch the contents of a URL over HTTP GET", httpGetSchema, httpGetTool)
+	tools.Register("json_extract", "Extract a value from a JSON document at a dot-separated path", jsonExtractSchema, jsonExtractTool)
+
 	return &GoAgent{
-		client: client,
+		client:     client,
+		tools:      tools,
+		config:     loadRuntimeConfig(),
+		configPath: os.Getenv("CONFIG_FILE"),
 	}, nil
 }
 
-func (a *GoAgent) Execute(prompt string, context map[string]interface{}) (map[string]interface{}, error) {
+// Execute runs the agent loop: it sends the prompt (plus any
+// registered tool schemas) to Claude, and for as long as the response
+// contains tool_use blocks, dispatches them through the ToolRegistry
+// and feeds the results back as the next user turn. It stops at the
+// first pure text/JSON answer or after maxToolIterations round-trips,
+// whichever comes first, and accumulates token usage/cost across every
+// round-trip.
+func (a *GoAgent) Execute(ctx context.Context, prompt string, promptContext map[string]interface{}) (map[string]interface{}, error) {
 	startTime := time.Now()
+	cfg := a.Config()
+	messages := []ClaudeMessage{
+		{Role: "user", Content: a.buildUserMessage(prompt, promptContext)},
+	}
 
-	// Build system prompt
-	systemPrompt := a.buildSystemPrompt()
+	resultText, totalInput, totalOutput, err := a.runToolLoop(ctx, cfg, cfg.SystemPrompt, messages)
+	if err != nil {
+		return nil, err
+	}
 
-	// Build user message
-	userMessage := a.buildUserMessage(prompt, context)
+	return a.buildExecuteResult(cfg, resultText, totalInput, totalOutput, startTime), nil
+}
 
-	// Call Claude API
-	response, err := a.client.CreateMessage(systemPrompt, userMessage)
-	if err != nil {
-		return nil, fmt.Errorf("Claude API call failed: %w", err)
+// ExecuteSession behaves like Execute but threads the call through a
+// persisted conversation: priorMessages (already trimmed to the
+// session's token budget by the caller) are replayed ahead of the new
+// prompt, and systemPrompt overrides the agent's default when
+// non-empty. It returns the new user/assistant turn the caller should
+// append to the session, alongside the usual execute result.
+func (a *GoAgent) ExecuteSession(ctx context.Context, systemPrompt string, priorMessages []ClaudeMessage, prompt string, promptContext map[string]interface{}) (map[string]interface{}, []ClaudeMessage, error) {
+	startTime := time.Now()
+	cfg := a.Config()
+	if systemPrompt == "" {
+		systemPrompt = cfg.SystemPrompt
 	}
 
-	// Extract result
-	var resultText string
-	if len(response.Content) > 0 {
-		resultText = response.Content[0].Text
+	userMessage := ClaudeMessage{Role: "user", Content: a.buildUserMessage(prompt, promptContext)}
+	messages := append(append([]ClaudeMessage(nil), priorMessages...), userMessage)
+
+	resultText, totalInput, totalOutput, err := a.runToolLoop(ctx, cfg, systemPrompt, messages)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Parse result (JSON or plain text)
-	result := a.parseResult(resultText)
+	newTurns := []ClaudeMessage{userMessage, {Role: "assistant", Content: resultText}}
+	return a.buildExecuteResult(cfg, resultText, totalInput, totalOutput, startTime), newTurns, nil
+}
 
-	// Calculate metrics
-	duration := time.Since(startTime).Milliseconds()
-	cost := a.client.CalculateCost(response.Usage.InputTokens, response.Usage.OutputTokens)
+// runToolLoop sends messages to Claude, dispatching any tool_use
+// blocks through the ToolRegistry and looping until a text answer
+// arrives or maxToolIterations round-trips are spent, whichever comes
+// first. Token usage is accumulated across every round-trip.
+func (a *GoAgent) runToolLoop(ctx context.Context, cfg RuntimeConfig, systemPrompt string, messages []ClaudeMessage) (resultText string, totalInput, totalOutput int, err error) {
+	logger := loggerFromContext(ctx)
+	toolDefs := a.tools.definitions()
+
+	for iteration := 0; iteration < maxToolIterations; iteration++ {
+		logger.Debug("calling Claude API", "model", cfg.Model, "iteration", iteration)
+		response, callErr := a.client.CreateMessage(ctx, cfg, systemPrompt, messages, toolDefs)
+		if callErr != nil {
+			return "", totalInput, totalOutput, fmt.Errorf("Claude API call failed: %w", callErr)
+		}
+
+		totalInput += response.Usage.InputTokens
+		totalOutput += response.Usage.OutputTokens
+
+		toolUses := extractToolUses(response.Content)
+		if len(toolUses) == 0 {
+			return extractText(response.Content), totalInput, totalOutput, nil
+		}
+
+		messages = append(messages, ClaudeMessage{Role: "assistant", Content: response.Content})
+		messages = append(messages, ClaudeMessage{Role: "user", Content: a.dispatchToolUses(logger, toolUses)})
+	}
+
+	logger.Warn("tool loop reached max iterations without a final answer", "maxIterations", maxToolIterations)
+	return "", totalInput, totalOutput, nil
+}
 
+func (a *GoAgent) buildExecuteResult(cfg RuntimeConfig, resultText string, totalInput, totalOutput int, startTime time.Time) map[string]interface{} {
 	return map[string]interface{}{
-		"result":   result,
-		"cost":     cost,
-		"duration": duration,
-		"model":    a.client.model,
+		"result":   a.parseResult(resultText),
+		"cost":     cfg.CalculateCost(totalInput, totalOutput),
+		"duration": time.Since(startTime).Milliseconds(),
+		"model":    cfg.Model,
 		"tokensUsed": map[string]int{
-			"input":  response.Usage.InputTokens,
-			"output": response.Usage.OutputTokens,
+			"input":  totalInput,
+			"output": totalOutput,
 		},
-	}, nil
+	}
 }
 
-func (a *GoAgent) buildSystemPrompt() string {
-	return `You are a helpful AI assistant specialized in data analysis and insights.
-
-Your task is to analyze the provided information and generate actionable insights.
+// dispatchToolUses runs each requested tool call through the registry
+// and builds the tool_result blocks to send back as the next turn.
+func (a *GoAgent) dispatchToolUses(logger *slog.Logger, toolUses []toolUse) []ToolResultBlock {
+	results := make([]ToolResultBlock, 0, len(toolUses))
+	for _, use := range toolUses {
+		block := ToolResultBlock{Type: "tool_result", ToolUseID: use.ID}
+
+		output, err := a.tools.dispatch(use.Name, use.Input)
+		if err != nil {
+			block.IsError = true
+			block.Content = err.Error()
+			logger.Error("tool call failed", "tool", use.Name, "error", err)
+		} else if encoded, marshalErr := json.Marshal(output); marshalErr != nil {
+			block.IsError = true
+			block.Content = marshalErr.Error()
+		} else {
+			block.Content = string(encoded)
+		}
 
-Respond with valid JSON in this format:
-{
-  "analysis": "Your detailed analysis",
-  "insights": ["insight 1", "insight 2", "insight 3"],
-  "recommendations": ["recommendation 1", "recommendation 2"]
-}`
+		results = append(results, block)
+	}
+	return results
 }
 
-func (a *GoAgent) buildUserMessage(prompt string, context map[string]interface{}) string {
+func (a *GoAgent) buildUserMessage(prompt string, promptContext map[string]interface{}) string {
 	message := fmt.Sprintf("User Query: %s\n\n", prompt)
 
-	if context != nil && len(context) > 0 {
+	if len(promptContext) > 0 {
 		message += "Additional Context:\n"
-		for key, value := range context {
+		for key, value := range promptContext {
 			message += fmt.Sprintf("- %s: %v\n", key, value)
 		}
 	}
@@ -340,6 +510,28 @@ func infoHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// executeWithSession loads the session's history, trims it to the
+// configured token budget, runs the agent against it, and persists the
+// resulting user/assistant turn back onto the session.
+func executeWithSession(ctx context.Context, input AgentInput) (map[string]interface{}, error) {
+	session, err := sessionStore.Get(ctx, input.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("session %q: %w", input.SessionID, err)
+	}
+
+	history := trimHistory(session.SystemPrompt, session.Messages, defaultMaxHistoryTokens)
+	resultData, newTurns, err := agent.ExecuteSession(ctx, session.SystemPrompt, history, input.Prompt, input.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := sessionStore.Append(ctx, input.SessionID, newTurns...); err != nil {
+		loggerFromContext(ctx).Error("failed to persist session turn", "error", err, "sessionId", input.SessionID)
+	}
+
+	return resultData, nil
+}
+
 func executeHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -352,12 +544,26 @@ func executeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Execute agent
-	resultData, err := agent.Execute(req.Input.Prompt, req.Input.Context)
+	ctx := r.Context()
+	if req.Metadata.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(req.Metadata.Timeout)*time.Second)
+		defer cancel()
+	}
+
+	// Execute agent, threading through a persisted session if requested
+	var resultData map[string]interface{}
+	var err error
+	if req.Input.SessionID != "" {
+		resultData, err = executeWithSession(ctx, req.Input)
+	} else {
+		resultData, err = agent.Execute(ctx, req.Input.Prompt, req.Input.Context)
+	}
 	if err != nil {
 		errMsg := err.Error()
+		loggerFromContext(ctx).Error("execute failed", "error", errMsg)
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(classifyExecuteError(err))
 		json.NewEncoder(w).Encode(ExecuteResponse{
 			Result: nil,
 			Metadata: ResultMetadata{
@@ -371,12 +577,14 @@ func executeHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Build response
 	tokensUsed := resultData["tokensUsed"].(map[string]int)
+	model := resultData["model"].(string)
+	cost := resultData["cost"].(float64)
 	response := ExecuteResponse{
 		Result: resultData["result"],
 		Metadata: ResultMetadata{
-			Cost:     resultData["cost"].(float64),
+			Cost:     cost,
 			Duration: resultData["duration"].(int64),
-			Model:    resultData["model"].(string),
+			Model:    model,
 			TokensUsed: &TokenUsage{
 				Input:  tokensUsed["input"],
 				Output: tokensUsed["output"],
@@ -384,6 +592,14 @@ func executeHandler(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
+	metrics.recordTokenUsage(model, tokensUsed["input"], tokensUsed["output"], cost)
+	loggerFromContext(ctx).Info("execute completed",
+		"model", model,
+		"cost", cost,
+		"inputTokens", tokensUsed["input"],
+		"outputTokens", tokensUsed["output"],
+	)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
@@ -404,10 +620,19 @@ func main() {
 		port = "8002"
 	}
 
-	http.HandleFunc("/", rootHandler)
-	http.HandleFunc("/health", healthHandler)
-	http.HandleFunc("/info", infoHandler)
-	http.HandleFunc("/execute", executeHandler)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", rootHandler)
+	mux.HandleFunc("/health", healthHandler)
+	mux.HandleFunc("/info", infoHandler)
+	mux.HandleFunc("/execute", executeHandler)
+	mux.HandleFunc("/execute/stream", executeStreamHandler)
+	mux.HandleFunc("/metrics", metricsHandler)
+	mux.HandleFunc("/sessions", sessionsHandler)
+	mux.HandleFunc("/sessions/", sessionsHandler)
+	mux.HandleFunc("/config", configHandler)
+
+	stack := Chain(recoveryMiddleware, requestIDMiddleware, loggingMiddleware)
+	handler := stack(mux)
 
 	fmt.Printf(`
     â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”
@@ -415,25 +640,32 @@ func main() {
     â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”
 
     Port:     %s
-    Model:    claude-sonnet-4-5-20250929
+    Model:    %s
 
     Endpoints:
       â€¢ GET  /           - Root
       â€¢ GET  /health     - Health check
       â€¢ GET  /info       - Agent metadata
       â€¢ POST /execute    - Execute agent
+      â€¢ POST /execute/stream - Execute agent (SSE)
+      â€¢ GET  /metrics    - Prometheus metrics
+      â€¢ POST /sessions   - Create a conversation session
+      â€¢ GET  /sessions/{id} - Get session history
+      â€¢ DELETE /sessions/{id} - Clear a session
+      â€¢ GET  /config     - Get runtime config
+      â€¢ PATCH /config    - Update runtime config
 
     Test with:
       curl http://localhost:%s/health
 
     â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”â”
-    `, port, port)
+    `, port, agent.Config().Model, port)
 
 	portNum, _ := strconv.Atoi(port)
 	addr := fmt.Sprintf(":%d", portNum)
 	log.Printf("Server listening on %s", addr)
 
-	if err := http.ListenAndServe(addr, nil); err != nil {
+	if err := http.ListenAndServe(addr, handler); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+)
+
+// scriptedTransport returns one canned *http.Response per call, in
+// order, so a test can drive the Claude client through a scripted
+// multi-turn exchange without a real network call.
+type scriptedTransport struct {
+	responses []*http.Response
+	calls     int
+}
+
+func (t *scriptedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.calls >= len(t.responses) {
+		return nil, fmt.Errorf("scriptedTransport: no response scripted for call %d", t.calls)
+	}
+	resp := t.responses[t.calls]
+	t.calls++
+	return resp, nil
+}
+
+func mustJSONResponse(t *testing.T, v any) *http.Response {
+	t.Helper()
+	body, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("failed to marshal scripted response: %v", err)
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Header:     make(http.Header),
+	}
+}
+
+func newTestClient(transport http.RoundTripper) *ClaudeClient {
+	return &ClaudeClient{
+		apiKey:     "test-key",
+		breaker:    newCircuitBreaker(circuitFailureThreshold, circuitCooldown),
+		httpClient: &http.Client{Transport: transport},
+	}
+}
+
+func TestRunToolLoop(t *testing.T) {
+	toolUseInput := json.RawMessage(`{"query":"go modules"}`)
+
+	cases := []struct {
+		name           string
+		responses      []ClaudeResponse
+		registerTool   func(tools *ToolRegistry, dispatched *json.RawMessage)
+		wantResult     string
+		wantInput      int
+		wantOutput     int
+		wantCalls      int
+		wantDispatched json.RawMessage
+	}{
+		{
+			name: "tool_use then final text",
+			responses: []ClaudeResponse{
+				{
+					Content: []ClaudeContent{
+						{Type: "tool_use", ID: "toolu_1", Name: "lookup", Input: toolUseInput},
+					},
+					Usage: ClaudeUsage{InputTokens: 10, OutputTokens: 5},
+				},
+				{
+					Content: []ClaudeContent{
+						{Type: "text", Text: `{"analysis":"done"}`},
+					},
+					Usage: ClaudeUsage{InputTokens: 20, OutputTokens: 8},
+				},
+			},
+			registerTool: func(tools *ToolRegistry, dispatched *json.RawMessage) {
+				tools.Register("lookup", "Look something up", json.RawMessage(`{"type":"object"}`), func(args json.RawMessage) (any, error) {
+					*dispatched = args
+					return map[string]string{"result": "go.mod declares the module path"}, nil
+				})
+			},
+			wantResult:     `{"analysis":"done"}`,
+			wantInput:      30,
+			wantOutput:     13,
+			wantCalls:      2,
+			wantDispatched: toolUseInput,
+		},
+		{
+			name: "failed tool dispatch still reaches a final answer",
+			responses: []ClaudeResponse{
+				{
+					Content: []ClaudeContent{
+						{Type: "tool_use", ID: "toolu_1", Name: "lookup", Input: toolUseInput},
+					},
+					Usage: ClaudeUsage{InputTokens: 10, OutputTokens: 5},
+				},
+				{
+					Content: []ClaudeContent{
+						{Type: "text", Text: `{"analysis":"recovered"}`},
+					},
+					Usage: ClaudeUsage{InputTokens: 15, OutputTokens: 6},
+				},
+			},
+			registerTool: func(tools *ToolRegistry, dispatched *json.RawMessage) {
+				tools.Register("lookup", "Look something up", json.RawMessage(`{"type":"object"}`), func(args json.RawMessage) (any, error) {
+					*dispatched = args
+					return nil, fmt.Errorf("lookup backend unavailable")
+				})
+			},
+			wantResult:     `{"analysis":"recovered"}`,
+			wantInput:      25,
+			wantOutput:     11,
+			wantCalls:      2,
+			wantDispatched: toolUseInput,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			scripted := make([]*http.Response, len(tc.responses))
+			for i, r := range tc.responses {
+				scripted[i] = mustJSONResponse(t, r)
+			}
+			transport := &scriptedTransport{responses: scripted}
+
+			tools := NewToolRegistry()
+			var dispatched json.RawMessage
+			tc.registerTool(tools, &dispatched)
+
+			agent := &GoAgent{client: newTestClient(transport), tools: tools}
+			cfg := RuntimeConfig{Model: "claude-sonnet-4-5-20250929", MaxTokens: 4000, Temperature: 1}
+
+			resultText, inputTokens, outputTokens, err := agent.runToolLoop(context.Background(), cfg, "system prompt", []ClaudeMessage{
+				{Role: "user", Content: "What does go.mod do?"},
+			})
+			if err != nil {
+				t.Fatalf("runToolLoop returned error: %v", err)
+			}
+			if resultText != tc.wantResult {
+				t.Fatalf("result text = %q, want %q", resultText, tc.wantResult)
+			}
+			if inputTokens != tc.wantInput || outputTokens != tc.wantOutput {
+				t.Fatalf("token totals = (%d, %d), want (%d, %d)", inputTokens, outputTokens, tc.wantInput, tc.wantOutput)
+			}
+			if transport.calls != tc.wantCalls {
+				t.Fatalf("Claude API calls = %d, want %d", transport.calls, tc.wantCalls)
+			}
+			if string(dispatched) != string(tc.wantDispatched) {
+				t.Fatalf("tool dispatched with args %s, want %s", dispatched, tc.wantDispatched)
+			}
+		})
+	}
+}
+
+func TestRunToolLoop_MaxIterationsWithoutFinalAnswer(t *testing.T) {
+	toolUseInput := json.RawMessage(`{"query":"loop forever"}`)
+
+	scripted := make([]*http.Response, 0, maxToolIterations)
+	for i := 0; i < maxToolIterations; i++ {
+		scripted = append(scripted, mustJSONResponse(t, ClaudeResponse{
+			Content: []ClaudeContent{
+				{Type: "tool_use", ID: fmt.Sprintf("toolu_%d", i), Name: "lookup", Input: toolUseInput},
+			},
+			Usage: ClaudeUsage{InputTokens: 1, OutputTokens: 1},
+		}))
+	}
+	transport := &scriptedTransport{responses: scripted}
+
+	tools := NewToolRegistry()
+	tools.Register("lookup", "Look something up", json.RawMessage(`{"type":"object"}`), func(args json.RawMessage) (any, error) {
+		return map[string]string{"result": "still looking"}, nil
+	})
+
+	agent := &GoAgent{client: newTestClient(transport), tools: tools}
+	cfg := RuntimeConfig{Model: "claude-sonnet-4-5-20250929", MaxTokens: 4000, Temperature: 1}
+
+	resultText, inputTokens, outputTokens, err := agent.runToolLoop(context.Background(), cfg, "system prompt", []ClaudeMessage{
+		{Role: "user", Content: "Never stop calling tools"},
+	})
+	if err != nil {
+		t.Fatalf("runToolLoop returned error: %v", err)
+	}
+	if resultText != "" {
+		t.Fatalf("expected empty result text once maxToolIterations is exhausted, got %q", resultText)
+	}
+	if inputTokens != maxToolIterations || outputTokens != maxToolIterations {
+		t.Fatalf("token totals = (%d, %d), want (%d, %d)", inputTokens, outputTokens, maxToolIterations, maxToolIterations)
+	}
+	if transport.calls != maxToolIterations {
+		t.Fatalf("Claude API calls = %d, want %d", transport.calls, maxToolIterations)
+	}
+}
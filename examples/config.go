@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// ============================================================================
+// Runtime configuration
+// ============================================================================
+
+const (
+	defaultModel              = "claude-sonnet-4-5-20250929"
+	defaultMaxTokens          = 4000
+	defaultInputCostPerToken  = 3.0 / 1_000_000  // $3 per 1M tokens
+	defaultOutputCostPerToken = 15.0 / 1_000_000 // $15 per 1M tokens
+	defaultTemperature        = 1.0
+)
+
+var defaultSystemPrompt = `You are a helpful AI assistant specialized in data analysis and insights.
+
+Your task is to analyze the provided information and generate actionable insights.
+
+Respond with valid JSON in this format:
+{
+  "analysis": "Your detailed analysis",
+  "insights": ["insight 1", "insight 2", "insight 3"],
+  "recommendations": ["recommendation 1", "recommendation 2"]
+}`
+
+// validModels is the set of models the agent is allowed to be
+// switched to at runtime. Keep in sync with whatever the deployed
+// ANTHROPIC_API_KEY actually has access to.
+var validModels = []string{
+	"claude-sonnet-4-5-20250929",
+	"claude-opus-4-1-20250805",
+	"claude-3-5-haiku-20241022",
+}
+
+func isValidModel(model string) bool {
+	for _, m := range validModels {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// RuntimeConfig holds the agent settings that can be changed without a
+// restart: which model to call, how it's billed, and the default
+// system prompt/temperature. GoAgent guards it with a RWMutex so
+// in-flight requests keep the snapshot they started with while new
+// ones pick up whatever PATCH /config last wrote.
+type RuntimeConfig struct {
+	Model              string  `json:"model"`
+	MaxTokens          int     `json:"maxTokens"`
+	InputCostPerToken  float64 `json:"inputCostPerToken"`
+	OutputCostPerToken float64 `json:"outputCostPerToken"`
+	SystemPrompt       string  `json:"systemPrompt"`
+	Temperature        float64 `json:"temperature"`
+}
+
+// CalculateCost estimates the USD cost of a call billed under cfg,
+// rounded to 4 decimal places.
+func (cfg RuntimeConfig) CalculateCost(inputTokens, outputTokens int) float64 {
+	inputCost := float64(inputTokens) * cfg.InputCostPerToken
+	outputCost := float64(outputTokens) * cfg.OutputCostPerToken
+	return float64(int((inputCost+outputCost)*10000)) / 10000
+}
+
+// loadRuntimeConfig builds the agent's starting RuntimeConfig. If
+// CONFIG_FILE points at a file from a previous PATCH /config, it wins
+// outright (it's a complete, previously-validated snapshot); otherwise
+// each field falls back from its CLAUDE_* env var to the hardcoded
+// default.
+func loadRuntimeConfig() RuntimeConfig {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if loaded, err := readConfigFile(path); err == nil {
+			return *loaded
+		}
+	}
+
+	cfg := RuntimeConfig{
+		Model:              defaultModel,
+		MaxTokens:          defaultMaxTokens,
+		InputCostPerToken:  defaultInputCostPerToken,
+		OutputCostPerToken: defaultOutputCostPerToken,
+		SystemPrompt:       defaultSystemPrompt,
+		Temperature:        defaultTemperature,
+	}
+
+	if v := os.Getenv("CLAUDE_MODEL"); v != "" {
+		cfg.Model = v
+	}
+	if v := os.Getenv("CLAUDE_MAX_TOKENS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			cfg.MaxTokens = n
+		}
+	}
+	if v := os.Getenv("CLAUDE_INPUT_COST_PER_TOKEN"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 {
+			cfg.InputCostPerToken = f
+		}
+	}
+	if v := os.Getenv("CLAUDE_OUTPUT_COST_PER_TOKEN"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 {
+			cfg.OutputCostPerToken = f
+		}
+	}
+	if v := os.Getenv("CLAUDE_SYSTEM_PROMPT"); v != "" {
+		cfg.SystemPrompt = v
+	}
+	if v := os.Getenv("CLAUDE_TEMPERATURE"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 && f <= 1 {
+			cfg.Temperature = f
+		}
+	}
+
+	return cfg
+}
+
+func readConfigFile(path string) (*RuntimeConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg RuntimeConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+func writeConfigFile(path string, cfg RuntimeConfig) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// ConfigPatch carries the subset of RuntimeConfig fields a PATCH
+// /config request wants to change; a nil field leaves the current
+// value untouched.
+type ConfigPatch struct {
+	Model              *string  `json:"model,omitempty"`
+	MaxTokens          *int     `json:"maxTokens,omitempty"`
+	InputCostPerToken  *float64 `json:"inputCostPerToken,omitempty"`
+	OutputCostPerToken *float64 `json:"outputCostPerToken,omitempty"`
+	SystemPrompt       *string  `json:"systemPrompt,omitempty"`
+	Temperature        *float64 `json:"temperature,omitempty"`
+}
+
+// Config returns a snapshot of the agent's current runtime
+// configuration, safe to read from a request goroutine without
+// blocking a concurrent PATCH /config.
+func (a *GoAgent) Config() RuntimeConfig {
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+	return a.config
+}
+
+// UpdateConfig validates patch, applies it to the agent's runtime
+// config, and - when CONFIG_FILE is set - persists the result so it
+// survives a restart. Requests already in flight keep running against
+// the config snapshot they started with.
+func (a *GoAgent) UpdateConfig(patch ConfigPatch) (RuntimeConfig, error) {
+	if patch.Model != nil && !isValidModel(*patch.Model) {
+		return RuntimeConfig{}, fmt.Errorf("unknown model %q", *patch.Model)
+	}
+	if patch.MaxTokens != nil && *patch.MaxTokens <= 0 {
+		return RuntimeConfig{}, fmt.Errorf("maxTokens must be positive")
+	}
+	if patch.InputCostPerToken != nil && *patch.InputCostPerToken < 0 {
+		return RuntimeConfig{}, fmt.Errorf("inputCostPerToken must not be negative")
+	}
+	if patch.OutputCostPerToken != nil && *patch.OutputCostPerToken < 0 {
+		return RuntimeConfig{}, fmt.Errorf("outputCostPerToken must not be negative")
+	}
+	if patch.Temperature != nil && (*patch.Temperature < 0 || *patch.Temperature > 1) {
+		return RuntimeConfig{}, fmt.Errorf("temperature must be between 0 and 1")
+	}
+
+	a.configMu.Lock()
+	defer a.configMu.Unlock()
+
+	if patch.Model != nil {
+		a.config.Model = *patch.Model
+	}
+	if patch.MaxTokens != nil {
+		a.config.MaxTokens = *patch.MaxTokens
+	}
+	if patch.InputCostPerToken != nil {
+		a.config.InputCostPerToken = *patch.InputCostPerToken
+	}
+	if patch.OutputCostPerToken != nil {
+		a.config.OutputCostPerToken = *patch.OutputCostPerToken
+	}
+	if patch.SystemPrompt != nil {
+		a.config.SystemPrompt = *patch.SystemPrompt
+	}
+	if patch.Temperature != nil {
+		a.config.Temperature = *patch.Temperature
+	}
+
+	updated := a.config
+	if a.configPath != "" {
+		if err := writeConfigFile(a.configPath, updated); err != nil {
+			return RuntimeConfig{}, fmt.Errorf("failed to persist config: %w", err)
+		}
+	}
+	return updated, nil
+}
+
+// ============================================================================
+// Config HTTP Handler
+// ============================================================================
+
+// configHandler serves GET /config (read the current runtime config)
+// and PATCH /config (update one or more fields).
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(agent.Config())
+
+	case http.MethodPatch:
+		var patch ConfigPatch
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		updated, err := agent.UpdateConfig(patch)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(updated)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the histogram upper bounds (seconds) used for
+// agent_request_duration_seconds, chosen to cover both a fast /health
+// check and a slow Claude round-trip.
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type requestKey struct {
+	route  string
+	status string
+}
+
+type tokenKey struct {
+	model string
+	kind  string // "input" or "output"
+}
+
+// durationHistogram accumulates a route's latency as fixed per-bucket
+// counters plus a running sum/count, the same incremental shape a real
+// Prometheus histogram uses - O(len(latencyBuckets)) per route rather
+// than growing with every request served.
+type durationHistogram struct {
+	bucketCounts []uint64 // parallel to latencyBuckets, cumulative (le semantics)
+	sum          float64
+	count        uint64
+}
+
+func newDurationHistogram() *durationHistogram {
+	return &durationHistogram{bucketCounts: make([]uint64, len(latencyBuckets))}
+}
+
+func (h *durationHistogram) observe(seconds float64) {
+	h.sum += seconds
+	h.count++
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.bucketCounts[i]++
+		}
+	}
+}
+
+// Metrics is a small, dependency-free stand-in for a Prometheus client
+// (this repo has no package manifest to pull client_golang through):
+// it tracks the counters/histograms the agent needs and renders them
+// in the Prometheus text exposition format at /metrics.
+type Metrics struct {
+	mu sync.Mutex
+
+	requestsTotal   map[requestKey]uint64
+	requestDuration map[string]*durationHistogram // route -> latency histogram
+	tokensTotal     map[tokenKey]uint64
+	costTotal       map[string]float64 // model -> cumulative cost
+	retriesTotal    map[string]uint64  // outcome ("retry", "circuit_open") -> count
+}
+
+var metrics = &Metrics{
+	requestsTotal:   make(map[requestKey]uint64),
+	requestDuration: make(map[string]*durationHistogram),
+	tokensTotal:     make(map[tokenKey]uint64),
+	costTotal:       make(map[string]float64),
+	retriesTotal:    make(map[string]uint64),
+}
+
+func (m *Metrics) recordRequest(route string, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requestsTotal[requestKey{route: route, status: strconv.Itoa(status)}]++
+
+	hist, ok := m.requestDuration[route]
+	if !ok {
+		hist = newDurationHistogram()
+		m.requestDuration[route] = hist
+	}
+	hist.observe(duration.Seconds())
+}
+
+func (m *Metrics) recordTokenUsage(model string, inputTokens, outputTokens int, cost float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokensTotal[tokenKey{model: model, kind: "input"}] += uint64(inputTokens)
+	m.tokensTotal[tokenKey{model: model, kind: "output"}] += uint64(outputTokens)
+	m.costTotal[model] += cost
+}
+
+func (m *Metrics) recordRetry(outcome string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retriesTotal[outcome]++
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(w, "# HELP agent_requests_total Total HTTP requests by route and status")
+	fmt.Fprintln(w, "# TYPE agent_requests_total counter")
+	for key, count := range metrics.requestsTotal {
+		fmt.Fprintf(w, "agent_requests_total{route=%q,status=%q} %d\n", key.route, key.status, count)
+	}
+
+	fmt.Fprintln(w, "# HELP agent_request_duration_seconds Request latency by route")
+	fmt.Fprintln(w, "# TYPE agent_request_duration_seconds histogram")
+	for route, hist := range metrics.requestDuration {
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(w, "agent_request_duration_seconds_bucket{route=%q,le=\"%g\"} %d\n", route, bound, hist.bucketCounts[i])
+		}
+		fmt.Fprintf(w, "agent_request_duration_seconds_bucket{route=%q,le=\"+Inf\"} %d\n", route, hist.count)
+		fmt.Fprintf(w, "agent_request_duration_seconds_sum{route=%q} %g\n", route, hist.sum)
+		fmt.Fprintf(w, "agent_request_duration_seconds_count{route=%q} %d\n", route, hist.count)
+	}
+
+	fmt.Fprintln(w, "# HELP agent_tokens_total Tokens used per model")
+	fmt.Fprintln(w, "# TYPE agent_tokens_total counter")
+	for key, count := range metrics.tokensTotal {
+		fmt.Fprintf(w, "agent_tokens_total{model=%q,kind=%q} %d\n", key.model, key.kind, count)
+	}
+
+	fmt.Fprintln(w, "# HELP agent_cost_usd_total Estimated USD cost per model")
+	fmt.Fprintln(w, "# TYPE agent_cost_usd_total counter")
+	for model, cost := range metrics.costTotal {
+		fmt.Fprintf(w, "agent_cost_usd_total{model=%q} %g\n", model, cost)
+	}
+
+	fmt.Fprintln(w, "# HELP agent_claude_retries_total Claude API call retries by outcome")
+	fmt.Fprintln(w, "# TYPE agent_claude_retries_total counter")
+	for outcome, count := range metrics.retriesTotal {
+		fmt.Fprintf(w, "agent_claude_retries_total{outcome=%q} %d\n", outcome, count)
+	}
+
+	if agent != nil {
+		state, consecutiveFailures := agent.client.breaker.Snapshot()
+		fmt.Fprintln(w, "# HELP agent_circuit_breaker_open Whether the Claude client's circuit breaker is currently open (1) or not (0)")
+		fmt.Fprintln(w, "# TYPE agent_circuit_breaker_open gauge")
+		fmt.Fprintf(w, "agent_circuit_breaker_open{state=%q} %d\n", state, boolToInt(state == circuitOpen.String()))
+
+		fmt.Fprintln(w, "# HELP agent_circuit_breaker_consecutive_failures Consecutive Claude API failures observed by the circuit breaker")
+		fmt.Fprintln(w, "# TYPE agent_circuit_breaker_consecutive_failures gauge")
+		fmt.Fprintf(w, "agent_circuit_breaker_consecutive_failures %d\n", consecutiveFailures)
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Middleware Chain
+// ============================================================================
+
+// Middleware wraps an http.Handler with cross-cutting behavior (logging,
+// recovery, auth, ...). Compose several with Chain.
+type Middleware func(http.Handler) http.Handler
+
+// Chain composes middlewares into a single one, applied outermost-first:
+// Chain(a, b, c)(h) behaves like a(b(c(h))) - a runs first, h runs last.
+func Chain(mws ...Middleware) Middleware {
+	return func(final http.Handler) http.Handler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			final = mws[i](final)
+		}
+		return final
+	}
+}
+
+type contextKey string
+
+const (
+	ctxKeyRequestID contextKey = "requestID"
+	ctxKeyLogger    contextKey = "logger"
+)
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKeyRequestID).(string)
+	return id
+}
+
+func loggerFromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(ctxKeyLogger).(*slog.Logger); ok {
+		return l
+	}
+	return accessLogger
+}
+
+var accessLogger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+// recoveryMiddleware turns a panic anywhere downstream into a 500
+// instead of taking the whole server down.
+func recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				loggerFromContext(r.Context()).Error("panic recovered", "error", rec, "path", r.URL.Path)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestIDMiddleware assigns every request a correlation ID - the
+// caller's AgentMetadata.RequestID if the JSON body already carries
+// one, else a freshly generated ULID - and attaches it, plus a logger
+// scoped to it, to the request context so downstream handlers and
+// GoAgent.Execute can emit correlated logs.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := peekRequestID(r)
+		if requestID == "" {
+			requestID = newULID()
+		}
+
+		logger := accessLogger.With("requestId", requestID)
+		ctx := context.WithValue(r.Context(), ctxKeyRequestID, requestID)
+		ctx = context.WithValue(ctx, ctxKeyLogger, logger)
+
+		w.Header().Set("X-Request-Id", requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// peekRequestID reads metadata.requestId out of the request body
+// without consuming it for downstream handlers.
+func peekRequestID(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return ""
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var probe struct {
+		Metadata AgentMetadata `json:"metadata"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return ""
+	}
+	return probe.Metadata.RequestID
+}
+
+// loggingMiddleware emits one structured access log line per request
+// and records it in the Prometheus-style metrics registry.
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		duration := time.Since(start)
+		metrics.recordRequest(routeLabel(r.URL.Path), rec.status, duration)
+		loggerFromContext(r.Context()).Info("access",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"durationMs", duration.Milliseconds(),
+		)
+	})
+}
+
+// routeLabel collapses a request path to its registered route pattern
+// before it's used as a metrics label, so a path segment that carries
+// an identifier (e.g. /sessions/{id}) doesn't mint a new, never-reused
+// label - and never-reclaimed memory - per distinct id.
+func routeLabel(path string) string {
+	if id := strings.TrimPrefix(path, "/sessions/"); id != path && id != "" {
+		return "/sessions/:id"
+	}
+	return path
+}
+
+// statusRecorder captures the status code written by a handler while
+// still passing through Flush/CloseNotify so streaming handlers
+// wrapped by the middleware chain keep working.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *statusRecorder) CloseNotify() <-chan bool {
+	if cn, ok := s.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return make(chan bool)
+}
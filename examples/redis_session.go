@@ -0,0 +1,83 @@
+//go:build redis
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisSessionStore is an optional SessionStore backed by Redis, for
+// deployments that run more than one agent instance and need session
+// history shared across them. It's only compiled in with `-tags
+// redis` (and the go-redis dependency vendored); swap
+// newMemorySessionStore() for newRedisSessionStore() in main() to use
+// it.
+type redisSessionStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func newRedisSessionStore(addr string, ttl time.Duration) *redisSessionStore {
+	return &redisSessionStore{
+		client: redis.NewClient(&redis.Options{Addr: addr}),
+		ttl:    ttl,
+	}
+}
+
+func (s *redisSessionStore) key(id string) string {
+	return "session:" + id
+}
+
+func (s *redisSessionStore) Create(ctx context.Context, systemPrompt string) (*Session, error) {
+	now := time.Now()
+	session := &Session{
+		ID:           newULID(),
+		SystemPrompt: systemPrompt,
+		Messages:     []ClaudeMessage{},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	return session, s.save(ctx, session)
+}
+
+func (s *redisSessionStore) Get(ctx context.Context, id string) (*Session, error) {
+	data, err := s.client.Get(ctx, s.key(id)).Bytes()
+	if err == redis.Nil {
+		return nil, errSessionNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("redis get failed: %w", err)
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to decode session: %w", err)
+	}
+	return &session, nil
+}
+
+func (s *redisSessionStore) Append(ctx context.Context, id string, messages ...ClaudeMessage) (*Session, error) {
+	session, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	session.Messages = append(session.Messages, messages...)
+	session.UpdatedAt = time.Now()
+	return session, s.save(ctx, session)
+}
+
+func (s *redisSessionStore) Delete(ctx context.Context, id string) error {
+	return s.client.Del(ctx, s.key(id)).Err()
+}
+
+func (s *redisSessionStore) save(ctx context.Context, session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+	return s.client.Set(ctx, s.key(session.ID), data, s.ttl).Err()
+}
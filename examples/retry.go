@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// Retry policy: exponential backoff with full jitter
+// ============================================================================
+
+const (
+	retryBaseDelay   = 500 * time.Millisecond
+	retryCapDelay    = 20 * time.Second
+	maxRetryAttempts = 5
+)
+
+// fullJitterBackoff returns a random delay in [0, min(cap, base*2^attempt)],
+// per the "full jitter" strategy: https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+func fullJitterBackoff(attempt int) time.Duration {
+	backoff := float64(retryBaseDelay) * math.Pow(2, float64(attempt))
+	if backoff > float64(retryCapDelay) {
+		backoff = float64(retryCapDelay)
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+// claudeAPIError carries enough detail from a non-200 Claude API
+// response to decide whether it's worth retrying.
+type claudeAPIError struct {
+	StatusCode int
+	ErrorType  string // e.g. "overloaded_error", "rate_limit_error", "invalid_request_error"
+	Message    string
+	RetryAfter time.Duration // parsed from the Retry-After header, 0 if absent
+}
+
+func (e *claudeAPIError) Error() string {
+	if e.ErrorType != "" {
+		return fmt.Sprintf("Claude API error (%d %s): %s", e.StatusCode, e.ErrorType, e.Message)
+	}
+	return fmt.Sprintf("Claude API error (%d): %s", e.StatusCode, e.Message)
+}
+
+type anthropicErrorEnvelope struct {
+	Type  string `json:"type"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// newClaudeAPIError builds a claudeAPIError from a non-200 response,
+// parsing Anthropic's {"error":{"type":...,"message":...}} body (when
+// present) and the Retry-After header.
+func newClaudeAPIError(resp *http.Response, body []byte) *claudeAPIError {
+	apiErr := &claudeAPIError{StatusCode: resp.StatusCode, Message: string(body)}
+
+	var envelope anthropicErrorEnvelope
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Error.Type != "" {
+		apiErr.ErrorType = envelope.Error.Type
+		apiErr.Message = envelope.Error.Message
+	}
+
+	if ra := resp.Header.Get("Retry-After"); ra != "" {
+		if seconds, err := strconv.Atoi(ra); err == nil {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+	}
+
+	return apiErr
+}
+
+func asClaudeAPIError(err error) (*claudeAPIError, bool) {
+	var apiErr *claudeAPIError
+	ok := errors.As(err, &apiErr)
+	return apiErr, ok
+}
+
+// isRetryableError distinguishes transient failures (HTTP 429/500-504,
+// Anthropic's overloaded_error/rate_limit_error, or a network error
+// with no HTTP response at all) from terminal ones (400/401/403,
+// invalid_request_error) that are pointless to retry.
+func isRetryableError(err error) bool {
+	if apiErr, ok := asClaudeAPIError(err); ok {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError,
+			http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		switch apiErr.ErrorType {
+		case "overloaded_error", "rate_limit_error":
+			return true
+		}
+		return false
+	}
+
+	// No structured API error means the request never got a response
+	// (DNS/dial/connection-reset) - treat that as transient too.
+	return true
+}
+
+// ============================================================================
+// Circuit breaker
+// ============================================================================
+
+const (
+	circuitFailureThreshold = 5
+	circuitCooldown         = 30 * time.Second
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker fails requests fast once a downstream dependency has
+// failed consecutiveFailures times in a row: closed -> open after the
+// threshold, then a single half-open probe is allowed once cooldown
+// has elapsed, which decides whether to close again or re-open.
+type circuitBreaker struct {
+	mu                  sync.Mutex
+	state               circuitState
+	consecutiveFailures int
+	openedAt            time.Time
+	halfOpenInFlight    bool // true while a half-open probe is outstanding
+
+	failureThreshold int
+	cooldown         time.Duration
+}
+
+func newCircuitBreaker(failureThreshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{failureThreshold: failureThreshold, cooldown: cooldown}
+}
+
+// Allow reports whether a call should be attempted right now, moving
+// the breaker from open to half-open once the cooldown has elapsed.
+// Only one half-open probe is ever in flight at a time - concurrent
+// callers that lose the race keep failing fast until that probe's
+// outcome is recorded.
+func (b *circuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = circuitHalfOpen
+		b.halfOpenInFlight = true
+		return true
+	case circuitHalfOpen:
+		if b.halfOpenInFlight {
+			return false
+		}
+		b.halfOpenInFlight = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.consecutiveFailures = 0
+	b.state = circuitClosed
+	b.halfOpenInFlight = false
+}
+
+func (b *circuitBreaker) RecordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.consecutiveFailures++
+	b.halfOpenInFlight = false
+	if b.state == circuitHalfOpen || b.consecutiveFailures >= b.failureThreshold {
+		b.state = circuitOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Release frees up a half-open probe slot without recording a success
+// or failure, for a call that Allow let through but that errored out
+// before it learned anything about the downstream's health (caller
+// cancellation, a terminal client-side error). Without this, such a
+// call would leave halfOpenInFlight set forever and wedge the breaker
+// half-open.
+func (b *circuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.halfOpenInFlight = false
+}
+
+// Snapshot returns the breaker's current state name and consecutive
+// failure count, for the /metrics endpoint.
+func (b *circuitBreaker) Snapshot() (string, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state.String(), b.consecutiveFailures
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errSessionNotFound = errors.New("session not found")
+
+// defaultMaxHistoryTokens bounds how much conversation history is
+// replayed to Claude per session turn. Configurable via
+// MAX_HISTORY_TOKENS since Anthropic bills on the full context sent
+// with every call, not just the new turn.
+var defaultMaxHistoryTokens = loadMaxHistoryTokens()
+
+func loadMaxHistoryTokens() int {
+	if v := os.Getenv("MAX_HISTORY_TOKENS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 150_000
+}
+
+// Session holds the persisted conversation state for a single
+// sessionId: the message history sent to Claude so far, plus an
+// optional per-session system prompt override.
+type Session struct {
+	ID           string          `json:"id"`
+	SystemPrompt string          `json:"systemPrompt,omitempty"`
+	Messages     []ClaudeMessage `json:"messages"`
+	CreatedAt    time.Time       `json:"createdAt"`
+	UpdatedAt    time.Time       `json:"updatedAt"`
+}
+
+// SessionStore persists conversation history across requests. The
+// default implementation (memorySessionStore below) keeps everything
+// in process memory; build with `-tags redis` to back it with Redis
+// instead (see redis_session.go).
+type SessionStore interface {
+	Create(ctx context.Context, systemPrompt string) (*Session, error)
+	Get(ctx context.Context, id string) (*Session, error)
+	Append(ctx context.Context, id string, messages ...ClaudeMessage) (*Session, error)
+	Delete(ctx context.Context, id string) error
+}
+
+var sessionStore SessionStore = newMemorySessionStore()
+
+// memorySessionStore is the default, process-local SessionStore. It
+// does not survive a restart.
+type memorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+func newMemorySessionStore() *memorySessionStore {
+	return &memorySessionStore{sessions: make(map[string]*Session)}
+}
+
+func (s *memorySessionStore) Create(ctx context.Context, systemPrompt string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	session := &Session{
+		ID:           newULID(),
+		SystemPrompt: systemPrompt,
+		Messages:     []ClaudeMessage{},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	s.sessions[session.ID] = session
+	return cloneSession(session), nil
+}
+
+func (s *memorySessionStore) Get(ctx context.Context, id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, errSessionNotFound
+	}
+	return cloneSession(session), nil
+}
+
+func (s *memorySessionStore) Append(ctx context.Context, id string, messages ...ClaudeMessage) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, errSessionNotFound
+	}
+	session.Messages = append(session.Messages, messages...)
+	session.UpdatedAt = time.Now()
+	return cloneSession(session), nil
+}
+
+func (s *memorySessionStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+func cloneSession(s *Session) *Session {
+	clone := *s
+	clone.Messages = append([]ClaudeMessage(nil), s.Messages...)
+	return &clone
+}
+
+// trimHistory drops the oldest turns until the remaining messages, on
+// top of systemPrompt, are estimated to fit within maxTokens. There's
+// no local tokenizer available, so sizes are approximated as
+// len(text)/4 - accurate enough to decide when to drop turns without
+// an extra API round-trip. Messages are stored as [user, assistant,
+// user, assistant, ...] pairs, and the Messages API rejects a
+// conversation that doesn't start with a user turn, so trimming always
+// drops in pairs rather than leaving a lone leading assistant message.
+func trimHistory(systemPrompt string, messages []ClaudeMessage, maxTokens int) []ClaudeMessage {
+	if maxTokens <= 0 {
+		return messages
+	}
+
+	budget := maxTokens - estimateTokens(systemPrompt)
+	trimmed := messages
+	for len(trimmed) > 0 && estimateHistoryTokens(trimmed) > budget {
+		trimmed = trimmed[1:]
+	}
+	// Dropping one at a time can leave a lone leading assistant message
+	// behind; drop it too so the replayed history always starts with user.
+	for len(trimmed) > 0 && trimmed[0].Role != "user" {
+		trimmed = trimmed[1:]
+	}
+	return trimmed
+}
+
+func estimateTokens(text string) int {
+	return len(text) / 4
+}
+
+func estimateHistoryTokens(messages []ClaudeMessage) int {
+	total := 0
+	for _, m := range messages {
+		if content, ok := m.Content.(string); ok {
+			total += estimateTokens(content)
+			continue
+		}
+		if encoded, err := json.Marshal(m.Content); err == nil {
+			total += estimateTokens(string(encoded))
+		}
+	}
+	return total
+}
+
+// ============================================================================
+// Session HTTP Handlers
+// ============================================================================
+
+// sessionsHandler serves POST /sessions, GET /sessions/{id}, and
+// DELETE /sessions/{id}. Go 1.21's http.ServeMux can't pattern-match
+// path segments, so the id is pulled out by hand.
+func sessionsHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/sessions"), "/")
+
+	switch {
+	case r.Method == http.MethodPost && id == "":
+		createSessionHandler(w, r)
+	case r.Method == http.MethodGet && id != "":
+		getSessionHandler(w, r, id)
+	case r.Method == http.MethodDelete && id != "":
+		deleteSessionHandler(w, r, id)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+func createSessionHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SystemPrompt string `json:"systemPrompt,omitempty"`
+	}
+	if r.Body != nil {
+		// The body is optional - a bare POST /sessions with no
+		// system-prompt override is valid.
+		_ = json.NewDecoder(r.Body).Decode(&req)
+	}
+
+	session, err := sessionStore.Create(r.Context(), req.SystemPrompt)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create session: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(session)
+}
+
+func getSessionHandler(w http.ResponseWriter, r *http.Request, id string) {
+	session, err := sessionStore.Get(r.Context(), id)
+	if errors.Is(err, errSessionNotFound) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to load session: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+func deleteSessionHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if err := sessionStore.Delete(r.Context(), id); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to delete session: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
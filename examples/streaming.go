@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultTTFT bounds how long CreateMessageStream waits for the first
+// event before giving up, independent of the overall request deadline
+// carried by ctx. A model that never starts responding shouldn't hold
+// the connection open for the full request timeout.
+const defaultTTFT = 15 * time.Second
+
+// deadlineTimer enforces a "time to first token" deadline that is
+// separate from (and normally shorter than) the overall request
+// deadline already carried by ctx. If no event arrives before ttft
+// elapses, it closes body, aborting the in-flight read. Once the first
+// event is observed, MarkFirstByte stops the timer so the rest of the
+// stream is bounded only by the caller's context.
+type deadlineTimer struct {
+	mu    sync.Mutex
+	timer *time.Timer
+	fired bool
+}
+
+func newDeadlineTimer(ttft time.Duration, body io.Closer) *deadlineTimer {
+	dt := &deadlineTimer{}
+	dt.timer = time.AfterFunc(ttft, func() {
+		dt.mu.Lock()
+		defer dt.mu.Unlock()
+		if !dt.fired {
+			dt.fired = true
+			body.Close()
+		}
+	})
+	return dt
+}
+
+// MarkFirstByte stops the TTFT timer once the caller has observed the
+// first byte of the stream, so later, legitimately slow chunks aren't
+// mistaken for a stalled response.
+func (dt *deadlineTimer) MarkFirstByte() {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	if !dt.fired {
+		dt.fired = true
+		dt.timer.Stop()
+	}
+}
+
+func (dt *deadlineTimer) Stop() {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	if !dt.fired {
+		dt.fired = true
+		dt.timer.Stop()
+	}
+}
+
+// ============================================================================
+// Claude Streaming Client (Server-Sent Events)
+// ============================================================================
+
+type StreamEventType string
+
+const (
+	StreamEventMessageStart      StreamEventType = "message_start"
+	StreamEventContentBlockStart StreamEventType = "content_block_start"
+	StreamEventContentBlockDelta StreamEventType = "content_block_delta"
+	StreamEventContentBlockStop  StreamEventType = "content_block_stop"
+	StreamEventMessageDelta      StreamEventType = "message_delta"
+	StreamEventMessageStop       StreamEventType = "message_stop"
+	StreamEventPing              StreamEventType = "ping"
+	StreamEventError             StreamEventType = "error"
+)
+
+type StreamDelta struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// StreamEvent is the typed, decoded form of a single `text/event-stream`
+// frame from the Claude Messages API. Err is set (and Type is
+// StreamEventError) when the frame itself is malformed or the stream
+// read failed.
+type StreamEvent struct {
+	Type  StreamEventType `json:"type"`
+	Index int             `json:"index,omitempty"`
+	Delta *StreamDelta    `json:"delta,omitempty"`
+	Usage *ClaudeUsage    `json:"usage,omitempty"`
+	Err   error           `json:"-"`
+}
+
+type rawMessageStart struct {
+	Message struct {
+		Usage ClaudeUsage `json:"usage"`
+	} `json:"message"`
+}
+
+type rawMessageDelta struct {
+	Usage struct {
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+type rawContentBlockDelta struct {
+	Index int         `json:"index"`
+	Delta StreamDelta `json:"delta"`
+}
+
+// CreateMessageStream sends the same request as CreateMessage but with
+// stream: true, and returns a channel of decoded StreamEvents as they
+// arrive over the SSE connection. The channel is closed when the stream
+// ends (message_stop or a read error). Final token usage can be
+// reconstructed from the message_start and message_delta events.
+func (c *ClaudeClient) CreateMessageStream(ctx context.Context, cfg RuntimeConfig, system, userMessage string) (<-chan StreamEvent, error) {
+	reqBody := ClaudeRequest{
+		Model:       cfg.Model,
+		MaxTokens:   cfg.MaxTokens,
+		System:      system,
+		Stream:      true,
+		Temperature: cfg.Temperature,
+		Messages: []ClaudeMessage{
+			{
+				Role:    "user",
+				Content: userMessage,
+			},
+		},
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", strings.NewReader(string(jsonData)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", c.apiKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+	req.Header.Set("Accept", "text/event-stream")
+
+	// Streaming responses can legitimately stay open for minutes; rely on
+	// ctx to bound total duration rather than a client-wide timeout.
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Claude API error (%d): %s", resp.StatusCode, string(body))
+	}
+
+	events := make(chan StreamEvent)
+	dt := newDeadlineTimer(defaultTTFT, resp.Body)
+	go readStreamEvents(ctx, resp.Body, events, dt)
+
+	return events, nil
+}
+
+// readStreamEvents parses an SSE body line-by-line, decoding each
+// `event: <name>` / `data: <json>` pair into a StreamEvent and
+// publishing it on events. It closes events (and the body) when the
+// stream ends, and releases dt's TTFT deadline as soon as the first
+// line is read. Sends select on ctx so that a caller who stops
+// draining events (e.g. because its client disconnected) doesn't leave
+// this goroutine blocked on the unbuffered channel forever.
+func readStreamEvents(ctx context.Context, body io.ReadCloser, events chan<- StreamEvent, dt *deadlineTimer) {
+	defer close(events)
+	defer body.Close()
+	defer dt.Stop()
+
+	send := func(evt StreamEvent) bool {
+		select {
+		case events <- evt:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var eventName string
+	first := true
+	for scanner.Scan() {
+		if first {
+			dt.MarkFirstByte()
+			first = false
+		}
+
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			eventName = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			if evt, ok := parseStreamEvent(eventName, data); ok {
+				if !send(evt) {
+					return
+				}
+			}
+		case line == "":
+			eventName = ""
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		send(StreamEvent{Type: StreamEventError, Err: err})
+	}
+}
+
+// parseStreamEvent decodes a single SSE data payload according to its
+// event name. The second return value is false for events we don't
+// surface to callers (ping, unknown, empty).
+func parseStreamEvent(eventName, data string) (StreamEvent, bool) {
+	switch StreamEventType(eventName) {
+	case StreamEventMessageStart:
+		var raw rawMessageStart
+		if err := json.Unmarshal([]byte(data), &raw); err != nil {
+			return StreamEvent{Type: StreamEventError, Err: err}, true
+		}
+		usage := raw.Message.Usage
+		return StreamEvent{Type: StreamEventMessageStart, Usage: &usage}, true
+
+	case StreamEventContentBlockDelta:
+		var raw rawContentBlockDelta
+		if err := json.Unmarshal([]byte(data), &raw); err != nil {
+			return StreamEvent{Type: StreamEventError, Err: err}, true
+		}
+		return StreamEvent{Type: StreamEventContentBlockDelta, Index: raw.Index, Delta: &raw.Delta}, true
+
+	case StreamEventMessageDelta:
+		var raw rawMessageDelta
+		if err := json.Unmarshal([]byte(data), &raw); err != nil {
+			return StreamEvent{Type: StreamEventError, Err: err}, true
+		}
+		return StreamEvent{Type: StreamEventMessageDelta, Usage: &ClaudeUsage{OutputTokens: raw.Usage.OutputTokens}}, true
+
+	case StreamEventMessageStop:
+		return StreamEvent{Type: StreamEventMessageStop}, true
+
+	case StreamEventError:
+		return StreamEvent{Type: StreamEventError, Err: fmt.Errorf("upstream stream error: %s", data)}, true
+
+	case StreamEventContentBlockStart, StreamEventContentBlockStop, StreamEventPing, "":
+		return StreamEvent{}, false
+
+	default:
+		return StreamEvent{}, false
+	}
+}
+
+// ============================================================================
+// Streaming HTTP Handler
+// ============================================================================
+
+// executeStreamHandler relays the Claude SSE stream directly to the HTTP
+// client, frame for frame, then appends a final "metadata" frame with
+// the same cost/duration/tokensUsed shape as the non-streaming /execute
+// response once usage has been fully aggregated.
+func executeStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ExecuteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	if req.Metadata.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(req.Metadata.Timeout)*time.Second)
+		defer cancel()
+	}
+	// Cancelled on every exit path below (including a client disconnect
+	// caught only via clientGone), so readStreamEvents's goroutine never
+	// blocks forever trying to send to an events channel nobody drains.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	startTime := time.Now()
+	cfg := agent.Config()
+	userMessage := agent.buildUserMessage(req.Input.Prompt, req.Input.Context)
+
+	events, err := agent.client.CreateMessageStream(ctx, cfg, cfg.SystemPrompt, userMessage)
+	if err != nil {
+		errMsg := err.Error()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(classifyExecuteError(err))
+		json.NewEncoder(w).Encode(ExecuteResponse{Error: &errMsg})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	var clientGone <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		clientGone = cn.CloseNotify()
+	}
+
+	var inputTokens, outputTokens int
+	for {
+		select {
+		case evt, open := <-events:
+			if !open {
+				writeSSE(w, "metadata", ResultMetadata{
+					Cost:       cfg.CalculateCost(inputTokens, outputTokens),
+					Duration:   time.Since(startTime).Milliseconds(),
+					Model:      cfg.Model,
+					TokensUsed: &TokenUsage{Input: inputTokens, Output: outputTokens},
+				})
+				flusher.Flush()
+				return
+			}
+
+			if evt.Err != nil {
+				writeSSE(w, "error", map[string]string{"error": evt.Err.Error()})
+				flusher.Flush()
+				continue
+			}
+			if evt.Usage != nil {
+				if evt.Type == StreamEventMessageStart {
+					inputTokens = evt.Usage.InputTokens
+				}
+				if evt.Usage.OutputTokens > 0 {
+					outputTokens = evt.Usage.OutputTokens
+				}
+			}
+
+			writeSSE(w, string(evt.Type), evt)
+			flusher.Flush()
+
+		case <-clientGone:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, event string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\n", event)
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
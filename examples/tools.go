@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxToolIterations bounds the tool-use loop in GoAgent.Execute so a
+// model that keeps calling tools can't hang a request indefinitely.
+const maxToolIterations = 8
+
+// ToolDefinition is the schema Claude sees for a registered tool, sent
+// as part of ClaudeRequest.Tools.
+type ToolDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// ToolResultBlock is the content block sent back to Claude after
+// dispatching a tool_use request.
+type ToolResultBlock struct {
+	Type      string `json:"type"`
+	ToolUseID string `json:"tool_use_id"`
+	Content   string `json:"content"`
+	IsError   bool   `json:"is_error,omitempty"`
+}
+
+// toolUse is the decoded form of a tool_use content block in a Claude
+// response.
+type toolUse struct {
+	ID    string
+	Name  string
+	Input json.RawMessage
+}
+
+func extractToolUses(blocks []ClaudeContent) []toolUse {
+	var uses []toolUse
+	for _, block := range blocks {
+		if block.Type == "tool_use" {
+			uses = append(uses, toolUse{ID: block.ID, Name: block.Name, Input: block.Input})
+		}
+	}
+	return uses
+}
+
+func extractText(blocks []ClaudeContent) string {
+	for _, block := range blocks {
+		if block.Type == "text" {
+			return block.Text
+		}
+	}
+	return ""
+}
+
+// ToolHandler executes a registered tool given the model's chosen
+// arguments and returns a JSON-serializable result. A returned error is
+// reported back to the model as an is_error tool_result rather than
+// failing the whole request.
+type ToolHandler func(args json.RawMessage) (any, error)
+
+type registeredTool struct {
+	definition ToolDefinition
+	handler    ToolHandler
+}
+
+// ToolRegistry holds the Go functions a GoAgent exposes to Claude as
+// callable tools, keyed by name.
+type ToolRegistry struct {
+	mu    sync.RWMutex
+	tools map[string]registeredTool
+}
+
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{tools: make(map[string]registeredTool)}
+}
+
+// Register adds a tool under name, described to the model by
+// description and schema (a JSON Schema object describing its
+// arguments). Registering the same name twice overwrites the previous
+// entry.
+func (r *ToolRegistry) Register(name, description string, schema json.RawMessage, handler ToolHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tools[name] = registeredTool{
+		definition: ToolDefinition{
+			Name:        name,
+			Description: description,
+			InputSchema: schema,
+		},
+		handler: handler,
+	}
+}
+
+// definitions returns the schemas for every registered tool, in the
+// form Claude expects on ClaudeRequest.Tools.
+func (r *ToolRegistry) definitions() []ToolDefinition {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	defs := make([]ToolDefinition, 0, len(r.tools))
+	for _, t := range r.tools {
+		defs = append(defs, t.definition)
+	}
+	return defs
+}
+
+func (r *ToolRegistry) dispatch(name string, args json.RawMessage) (any, error) {
+	r.mu.RLock()
+	t, ok := r.tools[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown tool %q", name)
+	}
+	return t.handler(args)
+}
+
+// ============================================================================
+// Built-in tools
+// ============================================================================
+
+const maxToolResponseBytes = 64 * 1024
+
+var httpGetSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"url": {"type": "string", "description": "The URL to fetch"}
+	},
+	"required": ["url"]
+}`)
+
+// httpGetTool fetches a URL and returns its status code and body
+// (truncated to maxToolResponseBytes so a large response can't blow up
+// the conversation's token budget).
+func httpGetTool(args json.RawMessage) (any, error) {
+	var input struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if input.URL == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(input.URL)
+	if err != nil {
+		return nil, fmt.Errorf("http_get failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxToolResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return map[string]interface{}{
+		"status": resp.StatusCode,
+		"body":   string(body),
+	}, nil
+}
+
+var jsonExtractSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"json": {"type": "string", "description": "The JSON document to extract from"},
+		"path": {"type": "string", "description": "Dot-separated path into the document, e.g. \"result.items.0.name\""}
+	},
+	"required": ["json", "path"]
+}`)
+
+// jsonExtractTool pulls a single value out of a JSON document by a
+// dot-separated path, indexing into arrays with integer segments.
+func jsonExtractTool(args json.RawMessage) (any, error) {
+	var input struct {
+		JSON string `json:"json"`
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(args, &input); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal([]byte(input.JSON), &doc); err != nil {
+		return nil, fmt.Errorf("invalid json: %w", err)
+	}
+
+	return extractJSONPath(doc, strings.Split(input.Path, "."))
+}
+
+func extractJSONPath(doc interface{}, segments []string) (interface{}, error) {
+	current := doc
+	for _, segment := range segments {
+		if segment == "" {
+			continue
+		}
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[segment]
+			if !ok {
+				return nil, fmt.Errorf("path segment %q not found", segment)
+			}
+			current = value
+		case []interface{}:
+			idx, err := strconv.Atoi(segment)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, fmt.Errorf("invalid array index %q", segment)
+			}
+			current = node[idx]
+		default:
+			return nil, fmt.Errorf("cannot descend into %T at %q", current, segment)
+		}
+	}
+	return current, nil
+}
